@@ -21,6 +21,7 @@ import (
 	"github.com/docker/docker/builder/builder-next/exporter"
 	"github.com/docker/docker/builder/builder-next/exporter/mobyexporter"
 	"github.com/docker/docker/builder/builder-next/exporter/overrides"
+	mobyworker "github.com/docker/docker/builder/builder-next/worker"
 	"github.com/docker/docker/daemon/config"
 	"github.com/docker/docker/daemon/images"
 	"github.com/docker/docker/errdefs"
@@ -32,6 +33,7 @@ import (
 	"github.com/moby/buildkit/control"
 	"github.com/moby/buildkit/identity"
 	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/solver/llbsolver/cdidevices"
 	"github.com/moby/buildkit/util/entitlements"
 	"github.com/moby/buildkit/util/tracing"
 	"github.com/moby/sys/user"
@@ -109,13 +111,20 @@ type Builder struct {
 	mu             sync.Mutex
 	jobs           map[string]*buildJob
 	useSnapshotter bool
+	parallelismSem *mobyworker.ResizableSem
+	cdiManager     *cdidevices.Manager
 }
 
 // New creates a new builder
 func New(ctx context.Context, opt Opt) (*Builder, error) {
 	reqHandler := newReqBodyHandler(tracing.DefaultTransport)
 
-	c, err := newController(ctx, reqHandler, opt)
+	var psem *mobyworker.ResizableSem
+	if p := opt.BuilderConfig.MaxParallelism; p > 0 {
+		psem = mobyworker.NewResizableSem(p)
+	}
+
+	c, cdiManager, err := newController(ctx, reqHandler, opt, psem)
 	if err != nil {
 		return nil, err
 	}
@@ -125,11 +134,39 @@ func New(ctx context.Context, opt Opt) (*Builder, error) {
 		reqBodyHandler: reqHandler,
 		jobs:           map[string]*buildJob{},
 		useSnapshotter: opt.UseSnapshotter,
+		parallelismSem: psem,
+		cdiManager:     cdiManager,
 	}
 	return b, nil
 }
 
+// RefreshCDISpecs rescans the configured CDI spec directories, so device
+// specs installed after the daemon started (e.g. a GPU driver upgrade)
+// become usable without a restart. The spec directories are also watched
+// automatically; this is for the daemon's reload handler to force a rescan.
+// It is a no-op when no CDI spec directories are configured.
+func (b *Builder) RefreshCDISpecs() error {
+	if b.cdiManager == nil {
+		return nil
+	}
+	return b.cdiManager.Refresh()
+}
+
+// SetMaxParallelism adjusts the maximum number of concurrently running build
+// steps at runtime, so a configuration reload can drain a node (limit 0) or
+// raise the limit without restarting the daemon. Steps already running are
+// unaffected. It is a no-op when the builder was started without a
+// parallelism limit.
+func (b *Builder) SetMaxParallelism(limit int64) {
+	if b.parallelismSem != nil {
+		b.parallelismSem.SetLimit(limit)
+	}
+}
+
 func (b *Builder) Close() error {
+	if b.parallelismSem != nil {
+		b.parallelismSem.Close()
+	}
 	return b.controller.Close()
 }
 
@@ -194,8 +231,8 @@ func (b *Builder) Prune(ctx context.Context, opts types.BuildCachePruneOptions)
 	validFilters := make(map[string]bool, 1+len(cacheFields))
 	validFilters["unused-for"] = true
 	validFilters["until"] = true
-	validFilters["label"] = true  // TODO(tiborvass): handle label
-	validFilters["label!"] = true // TODO(tiborvass): handle label!
+	validFilters["label"] = true
+	validFilters["label!"] = true
 	for k, v := range cacheFields {
 		validFilters[k] = v
 	}
@@ -695,6 +732,26 @@ func toBuildkitPruneInfo(opts types.BuildCachePruneOptions) (client.PruneInfo, e
 		}
 	}
 
+	// Cache records carry the labels of the image they were pulled for (and
+	// any labels set explicitly through the cache API), exposed to the filter
+	// syntax as "labels.<key>".
+	for _, v := range opts.Filters.Get("label") {
+		if k, lv, ok := strings.Cut(v, "="); ok {
+			bkFilter = append(bkFilter, "labels."+k+"=="+lv)
+		} else {
+			bkFilter = append(bkFilter, "labels."+v)
+		}
+	}
+	for _, v := range opts.Filters.Get("label!") {
+		k, lv, ok := strings.Cut(v, "=")
+		if !ok {
+			return client.PruneInfo{}, errInvalidFilterValue{
+				errors.Errorf("%q filter expects a key=value pair", "label!"),
+			}
+		}
+		bkFilter = append(bkFilter, "labels."+k+"!="+lv)
+	}
+
 	if opts.ReservedSpace == 0 && opts.KeepStorage != 0 {
 		opts.ReservedSpace = opts.KeepStorage
 	}
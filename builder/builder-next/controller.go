@@ -3,6 +3,7 @@ package buildkit
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -62,11 +63,27 @@ import (
 	"tags.cncf.io/container-device-interface/pkg/cdi"
 )
 
-func newController(ctx context.Context, rt http.RoundTripper, opt Opt) (*control.Controller, error) {
+func newController(ctx context.Context, rt http.RoundTripper, opt Opt, psem *mobyworker.ResizableSem) (*control.Controller, *cdidevices.Manager, error) {
+	cdiManager, err := getCDIManager(opt.CDISpecDirs)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cdiManager != nil {
+		// The CDI cache watches the spec directories with fsnotify; this
+		// adds a polling fallback so driver installs are picked up even
+		// where the watch cannot fire.
+		cdiManager.StartAutoRefresh(ctx, 0)
+	}
+	var c *control.Controller
 	if opt.UseSnapshotter {
-		return newSnapshotterController(ctx, rt, opt)
+		c, err = newSnapshotterController(ctx, rt, opt, psem, cdiManager)
+	} else {
+		c, err = newGraphDriverController(ctx, rt, opt, psem, cdiManager)
 	}
-	return newGraphDriverController(ctx, rt, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, cdiManager, nil
 }
 
 func getTraceExporter(ctx context.Context) trace.SpanExporter {
@@ -83,7 +100,7 @@ func getTraceExporter(ctx context.Context) trace.SpanExporter {
 	return tc
 }
 
-func newSnapshotterController(ctx context.Context, rt http.RoundTripper, opt Opt) (*control.Controller, error) {
+func newSnapshotterController(ctx context.Context, rt http.RoundTripper, opt Opt, psem *mobyworker.ResizableSem, cdiManager *cdidevices.Manager) (*control.Controller, error) {
 	if err := os.MkdirAll(opt.Root, 0o711); err != nil {
 		return nil, err
 	}
@@ -111,11 +128,6 @@ func newSnapshotterController(ctx context.Context, rt http.RoundTripper, opt Opt
 
 	dns := getDNSConfig(opt.DNSConfig)
 
-	cdiManager, err := getCDIManager(opt.CDISpecDirs)
-	if err != nil {
-		return nil, err
-	}
-
 	workerOpts := containerd.WorkerOptions{
 		Root:            opt.Root,
 		Address:         opt.ContainerdAddress,
@@ -131,11 +143,24 @@ func newSnapshotterController(ctx context.Context, rt http.RoundTripper, opt Opt
 		Selinux:         false,
 		CDIManager:      cdiManager,
 	}
+	if psem != nil {
+		workerOpts.ParallelismSem = psem.Weighted()
+	}
+	// Prefer the IPv4 gateway, matching the run path (see getLabels).
+	for _, gip := range opt.DNSConfig.HostGatewayIPs {
+		workerOpts.HostGatewayIP = net.IP(gip.AsSlice())
+		if gip.Is4() {
+			break
+		}
+	}
 
 	wo, err := containerd.NewWorkerOpt(workerOpts, ctd.WithTimeout(60*time.Second))
 	if err != nil {
 		return nil, err
 	}
+	for _, w := range wo.Warnings {
+		log.G(ctx).Warnf("buildkit worker: %s", w)
+	}
 
 	policy, err := getGCPolicy(opt.BuilderConfig, opt.Root)
 	if err != nil {
@@ -223,7 +248,7 @@ func openHistoryDB(root string, fn string, cfg *config.BuilderHistoryConfig) (*b
 	return db, conf, nil
 }
 
-func newGraphDriverController(ctx context.Context, rt http.RoundTripper, opt Opt) (*control.Controller, error) {
+func newGraphDriverController(ctx context.Context, rt http.RoundTripper, opt Opt, psem *mobyworker.ResizableSem, cdiManager *cdidevices.Manager) (*control.Controller, error) {
 	if err := os.MkdirAll(opt.Root, 0o711); err != nil {
 		return nil, err
 	}
@@ -326,11 +351,6 @@ func newGraphDriverController(ctx context.Context, rt http.RoundTripper, opt Opt
 
 	dns := getDNSConfig(opt.DNSConfig)
 
-	cdiManager, err := getCDIManager(opt.CDISpecDirs)
-	if err != nil {
-		return nil, err
-	}
-
 	exec, err := newExecutor(root, opt.DefaultCgroupParent, opt.NetworkController, dns, opt.Rootless, opt.IdentityMapping, opt.ApparmorProfile, cdiManager)
 	if err != nil {
 		return nil, err
@@ -401,6 +421,9 @@ func newGraphDriverController(ctx context.Context, rt http.RoundTripper, opt Opt
 		Labels:            getLabels(opt, nil),
 		CDIManager:        cdiManager,
 	}
+	if psem != nil {
+		wopt.ParallelismSem = psem.Weighted()
+	}
 
 	wc := &worker.Controller{}
 	w, err := mobyworker.NewWorker(wopt)
@@ -0,0 +1,174 @@
+package worker
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// resizableSemMax bounds the capacity of the underlying semaphore. Limits
+// above this value are clamped.
+const resizableSemMax = int64(1) << 30
+
+// ResizableSem is a weighted semaphore whose limit can be adjusted at
+// runtime, e.g. from the daemon's configuration reload path. New
+// acquisitions honor the updated limit; units acquired under the previous
+// limit are unaffected and can always be released. A limit of zero blocks
+// all new acquisitions.
+//
+// Limit decreases take effect before SetLimit returns: free capacity above
+// the new limit is retired immediately, and capacity still occupied by
+// current holders is reserved by a queued acquisition that the underlying
+// FIFO semaphore orders ahead of any later acquirer. Acquirers already
+// queued when the limit drops keep their place in line. A limit change
+// issued while such a reservation is still pending replaces it.
+type ResizableSem struct {
+	sem *semaphore.Weighted
+
+	mu      sync.Mutex
+	desired int64 // most recently requested limit
+	applied int64 // limit currently reflected in the semaphore's capacity
+	pending int64 // capacity being retired by an in-flight reservation
+	// cancel aborts the in-flight reservation, if any, so a raised limit
+	// or Close does not leave its goroutine blocked forever.
+	cancel context.CancelFunc
+	closed bool
+}
+
+// NewResizableSem returns a semaphore allowing limit concurrent units.
+// Negative limits are treated as zero.
+func NewResizableSem(limit int64) *ResizableSem {
+	limit = clampLimit(limit)
+	s := &ResizableSem{
+		sem:     semaphore.NewWeighted(resizableSemMax),
+		desired: limit,
+		applied: limit,
+	}
+	// Reserve the capacity above the initial limit; this cannot fail on a
+	// fresh semaphore.
+	s.sem.TryAcquire(resizableSemMax - limit)
+	return s
+}
+
+func clampLimit(limit int64) int64 {
+	if limit < 0 {
+		return 0
+	}
+	if limit > resizableSemMax {
+		return resizableSemMax
+	}
+	return limit
+}
+
+// Weighted returns the underlying semaphore, for APIs that take a
+// *semaphore.Weighted. Acquisitions through it honor the current limit.
+func (s *ResizableSem) Weighted() *semaphore.Weighted {
+	return s.sem
+}
+
+// SetLimit adjusts the limit. Decreases are effective for new acquirers when
+// it returns; it never blocks on capacity held by current acquirers.
+func (s *ResizableSem) SetLimit(limit int64) {
+	limit = clampLimit(limit)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.desired = limit
+	if s.pending != 0 {
+		// Abort the in-flight reservation; its goroutine reconciles
+		// against the new limit when it exits.
+		s.cancel()
+		return
+	}
+	s.reconcileLocked()
+}
+
+// Limit returns the most recently requested limit.
+func (s *ResizableSem) Limit() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.desired
+}
+
+// Close aborts any in-flight limit adjustment so no goroutine outlives the
+// semaphore. The limit applied last stays in effect for the underlying
+// semaphore, which needs no cleanup of its own.
+func (s *ResizableSem) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.cancel != nil {
+		s.cancel()
+	}
+	return nil
+}
+
+// reconcileLocked moves the applied limit toward the desired one. Increases
+// apply immediately; decreases retire free capacity immediately and reserve
+// the remainder via startShrinkLocked. Callers hold s.mu; no reservation may
+// be in flight.
+func (s *ResizableSem) reconcileLocked() {
+	if s.closed {
+		return
+	}
+	if s.desired > s.applied {
+		s.sem.Release(s.desired - s.applied)
+		s.applied = s.desired
+		return
+	}
+	if s.desired < s.applied {
+		s.startShrinkLocked()
+	}
+}
+
+// startShrinkLocked retires the capacity between the applied and desired
+// limits. Whatever is free is taken synchronously; the rest is occupied by
+// current holders and is claimed by a queued reservation that does not
+// return capacity to the pool as holders release. It only returns once that
+// reservation is queued on the semaphore (or already satisfied), so the
+// lowered limit holds for every acquisition that starts afterwards.
+func (s *ResizableSem) startShrinkLocked() {
+	deficit := s.applied - s.desired
+	var got int64
+	for got < deficit && s.sem.TryAcquire(1) {
+		got++
+	}
+	s.applied -= got
+	rest := deficit - got
+	if rest == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.pending = rest
+	done := make(chan struct{})
+	go func() {
+		err := s.sem.Acquire(ctx, rest)
+		close(done)
+		cancel()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.pending = 0
+		s.cancel = nil
+		if err == nil {
+			s.applied -= rest
+		}
+		s.reconcileLocked()
+	}()
+	// TryAcquire(0) fails exactly when the semaphore has a queued waiter,
+	// so this loop ends once the reservation (or any earlier acquirer,
+	// which blocks TryAcquire just the same) is in line, or once the
+	// reservation was satisfied outright.
+	for s.sem.TryAcquire(0) {
+		select {
+		case <-done:
+			return
+		default:
+			runtime.Gosched()
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// eventually retries fn until it returns true or the timeout expires.
+func eventually(t *testing.T, fn func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if fn() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal(msg)
+}
+
+func TestResizableSemLimit(t *testing.T) {
+	s := NewResizableSem(2)
+	sem := s.Weighted()
+
+	assert.Check(t, sem.TryAcquire(1))
+	assert.Check(t, sem.TryAcquire(1))
+	assert.Check(t, !sem.TryAcquire(1), "acquired beyond the limit")
+	sem.Release(2)
+}
+
+func TestResizableSemShrink(t *testing.T) {
+	s := NewResizableSem(2)
+	sem := s.Weighted()
+
+	assert.Assert(t, sem.TryAcquire(2))
+	s.SetLimit(1)
+
+	// The removed capacity is reserved ahead of new acquirers even while
+	// the current holders still occupy it.
+	eventually(t, func() bool { return !sem.TryAcquire(1) }, "new acquisition succeeded above the lowered limit")
+
+	// Existing holders release unaffected; only one unit becomes available
+	// again under the new limit.
+	sem.Release(2)
+	eventually(t, func() bool { return sem.TryAcquire(1) }, "no capacity available after release under the new limit")
+	assert.Check(t, !sem.TryAcquire(1), "acquired beyond the lowered limit")
+	sem.Release(1)
+}
+
+func TestResizableSemZeroLimit(t *testing.T) {
+	s := NewResizableSem(1)
+	sem := s.Weighted()
+
+	assert.Assert(t, sem.TryAcquire(1))
+	s.SetLimit(0)
+
+	// Releasing the current holder must not deadlock.
+	done := make(chan struct{})
+	go func() {
+		sem.Release(1)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("release deadlocked with a zero limit")
+	}
+
+	eventually(t, func() bool { return !sem.TryAcquire(1) }, "acquired with a zero limit")
+
+	// Raising the limit unblocks acquisitions again.
+	s.SetLimit(2)
+	eventually(t, func() bool { return sem.TryAcquire(1) }, "no capacity available after raising the limit")
+	sem.Release(1)
+}
+
+func TestResizableSemClose(t *testing.T) {
+	s := NewResizableSem(2)
+	sem := s.Weighted()
+
+	// Close with a shrink reservation still waiting on current holders
+	// must abort it rather than leave its goroutine blocked.
+	assert.Assert(t, sem.TryAcquire(2))
+	s.SetLimit(1)
+	assert.NilError(t, s.Close())
+	sem.Release(2)
+
+	// Limit changes after Close are ignored.
+	s.SetLimit(0)
+}
+
+func TestResizableSemConcurrent(t *testing.T) {
+	const maxLimit = 5
+	s := NewResizableSem(maxLimit)
+	sem := s.Weighted()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		current atomic.Int64
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if err := sem.Acquire(ctx, 1); err != nil {
+					return
+				}
+				// Concurrency may briefly exceed a freshly lowered
+				// limit via existing holders, but never the highest
+				// limit ever configured.
+				if n := current.Add(1); n > maxLimit {
+					t.Errorf("%d concurrent holders, want at most %d", n, maxLimit)
+				}
+				time.Sleep(time.Millisecond)
+				current.Add(-1)
+				sem.Release(1)
+			}
+		}()
+	}
+
+	for _, limit := range []int64{3, 0, maxLimit, 1, 4} {
+		s.SetLimit(limit)
+		time.Sleep(20 * time.Millisecond)
+	}
+	cancel()
+	wg.Wait()
+}
@@ -88,6 +88,13 @@ type Opt struct {
 	Layers            LayerAccess
 	Platforms         []ocispec.Platform
 	CDIManager        *cdidevices.Manager
+	// ParallelismSem, when set, limits how many build steps run
+	// concurrently. Nil means unlimited.
+	ParallelismSem *semaphore.Weighted
+	// ParallelismTimeout bounds how long an exec waits for a parallelism
+	// slot before failing instead of blocking indefinitely. Zero waits
+	// forever.
+	ParallelismTimeout time.Duration
 }
 
 // Worker is a local worker instance with dedicated snapshotter, cache, and so on.
@@ -272,13 +279,12 @@ func (w *Worker) ResolveSourceMetadata(ctx context.Context, op *pb.SourceOp, opt
 // ResolveOp converts a LLB vertex into a LLB operation
 func (w *Worker) ResolveOp(v solver.Vertex, s frontend.FrontendLLBBridge, sm *session.Manager) (solver.Op, error) {
 	if baseOp, ok := v.Sys().(*pb.Op); ok {
-		// TODO do we need to pass a value here? Where should it come from? https://github.com/moby/buildkit/commit/b3cf7c43cfefdfd7a945002c0e76b54e346ab6cf
-		var parallelism *semaphore.Weighted
+		parallelism := w.Opt.ParallelismSem
 		switch op := baseOp.Op.(type) {
 		case *pb.Op_Source:
 			return ops.NewSourceOp(v, op, baseOp.Platform, w.SourceManager, parallelism, sm, w)
 		case *pb.Op_Exec:
-			return ops.NewExecOp(v, op, baseOp.Platform, w.CacheManager(), parallelism, sm, w.Executor(), w)
+			return ops.NewExecOp(v, op, baseOp.Platform, w.CacheManager(), parallelism, w.Opt.ParallelismTimeout, sm, w.Executor(), w)
 		case *pb.Op_File:
 			return ops.NewFileOp(v, op, w.CacheManager(), parallelism, w)
 		case *pb.Op_Build:
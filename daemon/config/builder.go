@@ -142,4 +142,9 @@ type BuilderConfig struct {
 	GC           BuilderGCConfig       `json:",omitempty"`
 	Entitlements BuilderEntitlements   `json:",omitempty"`
 	History      *BuilderHistoryConfig `json:",omitempty"`
+
+	// MaxParallelism limits the number of build steps that run
+	// concurrently. Zero means unlimited. It can be adjusted at runtime
+	// through a configuration reload without restarting the daemon.
+	MaxParallelism int64 `json:"max-parallelism,omitempty"`
 }
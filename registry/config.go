@@ -2,10 +2,12 @@ package registry // import "github.com/docker/docker/registry"
 
 import (
 	"context"
+	"math/rand"
 	"net"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -21,10 +23,214 @@ import (
 type ServiceOptions struct {
 	Mirrors            []string `json:"registry-mirrors,omitempty"`
 	InsecureRegistries []string `json:"insecure-registries,omitempty"`
+
+	// SkipTLSVerifyRegistries lists registries (`host` or `host:port`)
+	// for which TLS certificate verification is skipped, without ever
+	// falling back to plaintext http: connections stay on https and fail
+	// closed when the registry does not speak TLS. Use this instead of
+	// InsecureRegistries for registries with self-signed certificates
+	// when cleartext must not be permitted. A host listed in both keeps
+	// the combined InsecureRegistries behavior.
+	SkipTLSVerifyRegistries []string `json:"skip-tls-verify-registries,omitempty"`
+
+	// AuthEndpoints maps a registry host to the URL of the token auth
+	// endpoint to use for that host. When set, the authentication flow
+	// uses the configured endpoint instead of discovering it through the
+	// WWW-Authenticate realm returned by the registry.
+	AuthEndpoints map[string]string `json:"registry-auth-endpoints,omitempty"`
+
+	// NoProxyMirrors lists mirrors that are on an internal network and
+	// must be reached directly, bypassing any HTTP(S) proxy configured
+	// through the standard proxy environment variables. Mirrors not listed
+	// here respect the proxy environment as before.
+	NoProxyMirrors []string `json:"registry-mirrors-no-proxy,omitempty"`
+
+	// MirrorWeights maps a mirror URL to a relative weight (for example,
+	// its declared bandwidth). When set, mirror endpoints are ordered
+	// using a weighted shuffle, so higher-weight mirrors are tried first
+	// more often and pulls spread proportionally. Mirrors without a
+	// weight default to 1; without any weights, configuration order is
+	// preserved.
+	MirrorWeights map[string]int `json:"registry-mirror-weights,omitempty"`
+
+	// NondistributableArtifactsHubRepositories lists repository prefixes
+	// (e.g. "library/windows") on Docker Hub for which non-distributable
+	// (foreign) layers may be pulled through configured mirrors. Hub
+	// remains opted out for repositories not matching any prefix.
+	NondistributableArtifactsHubRepositories []string `json:"allow-nondistributable-artifacts-hub-repositories,omitempty"`
+
+	// HostMirrors maps an upstream registry host (`host` or `host:port`)
+	// to the mirrors to consult before contacting that host directly. It
+	// extends the pull-through cache support beyond Docker Hub; mirrors for
+	// Hub itself should keep using Mirrors.
+	HostMirrors map[string][]string `json:"registry-host-mirrors,omitempty"`
+
+	// StrictContentTypeMirrors lists mirrors whose responses must carry a
+	// registry content type. A misconfigured reverse proxy in front of a
+	// mirror can return HTML error pages with a 200 status; with this set,
+	// the puller treats such responses as a failure of the mirror and
+	// falls through to the next endpoint instead of parsing them.
+	StrictContentTypeMirrors []string `json:"registry-mirrors-strict-content-type,omitempty"`
+
+	// MirrorTimeouts maps a mirror URL to the timeouts bounding each pull
+	// attempt through that mirror, so a slow or unreachable mirror fails
+	// fast and the next endpoint is tried. Mirrors not listed keep the
+	// transport defaults.
+	MirrorTimeouts map[string]MirrorTimeout `json:"registry-mirror-timeouts,omitempty"`
+
+	// MirrorMediaTypes maps a mirror URL to the manifest media types it
+	// serves (e.g. only OCI image manifests). The list is surfaced as a
+	// hint on the resolved endpoint, so the puller can skip the mirror
+	// for images with unsupported media types and go straight upstream.
+	// Mirrors not listed carry no restriction and are used for all types.
+	MirrorMediaTypes map[string][]string `json:"registry-mirror-media-types,omitempty"`
+
+	// DefaultRegistry overrides the official registry endpoint used as
+	// the final fallback when resolving Docker Hub pulls, for
+	// installations that operate an authoritative Hub replacement. It
+	// must be an https:// URL. When empty, Docker Hub (DefaultV2Registry)
+	// is used. Endpoints resolved from the override keep the Official
+	// flag.
+	DefaultRegistry string `json:"default-registry,omitempty"`
+
+	// MirrorCredentials maps a mirror URL to the basic-auth credentials
+	// used when pulling through that mirror, for mirrors that require
+	// infra-internal authentication outside the user credential store.
+	// The credentials are only sent to the mirror itself, never to the
+	// upstream registry, and are never logged. Mirrors not listed keep
+	// the current unauthenticated behavior.
+	MirrorCredentials map[string]MirrorAuth `json:"registry-mirror-credentials,omitempty"`
+
+	// MirrorHeaders maps a mirror URL to extra HTTP headers sent with
+	// every request to that mirror, for mirrors fronted by a CDN or
+	// gateway that requires e.g. an API key header. The headers are only
+	// sent to the mirror itself, never to the upstream registry, and the
+	// values are treated as secrets: they are redacted when the
+	// configuration is formatted and must never be logged. Mirrors not
+	// listed get no extra headers.
+	MirrorHeaders map[string]MirrorHeaders `json:"registry-mirror-headers,omitempty"`
+
+	// InsecureRepositories lists "host/repository-prefix" entries for
+	// which insecure endpoints (TLS without verification, plus a plaintext
+	// http fallback) are allowed even though the host itself is treated as
+	// secure. This covers a single registry host serving a secured public
+	// namespace and an insecure internal one under different repository
+	// paths. Prefixes match whole path segments: an entry
+	// "registry.example.com/internal" covers "internal/app" but not
+	// "internal-tools/app". Repositories matching no entry keep the
+	// host-level decision. Docker Hub is not supported.
+	InsecureRepositories []string `json:"insecure-repositories,omitempty"`
+}
+
+// MirrorTimeout bounds pull attempts through a single mirror. Values are in
+// seconds; zero keeps the transport default.
+type MirrorTimeout struct {
+	// DialSeconds bounds establishing a connection (including the TLS
+	// handshake) to the mirror.
+	DialSeconds int `json:"dial,omitempty"`
+	// RequestSeconds bounds a whole request through the mirror.
+	RequestSeconds int `json:"request,omitempty"`
+}
+
+// MirrorAuth holds basic-auth credentials for a single mirror. The password
+// may be given inline or as a path to a file holding it, so the daemon
+// configuration itself does not need to contain the secret.
+type MirrorAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"`
+	// PasswordFile names a file whose (whitespace-trimmed) contents are
+	// used as the password. Mutually exclusive with Password.
+	PasswordFile string `json:"password-file,omitempty"`
+}
+
+// String implements fmt.Stringer, redacting the secret so MirrorAuth values
+// are safe to log.
+func (a MirrorAuth) String() string {
+	return a.Username + ":*****"
+}
+
+// GoString implements fmt.GoStringer; see [MirrorAuth.String].
+func (a MirrorAuth) GoString() string {
+	return "MirrorAuth{Username: " + strconv.Quote(a.Username) + ", Password: \"*****\"}"
+}
+
+// MirrorHeaders holds extra HTTP headers for a single mirror, keyed by header
+// name. Values may be secrets (API keys, signed tokens) and are redacted when
+// the map is formatted.
+type MirrorHeaders map[string]string
+
+// String implements fmt.Stringer, redacting the values so MirrorHeaders are
+// safe to log.
+func (h MirrorHeaders) String() string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name+":*****")
+	}
+	sort.Strings(names)
+	return "[" + strings.Join(names, " ") + "]"
+}
+
+// GoString implements fmt.GoStringer; see [MirrorHeaders.String].
+func (h MirrorHeaders) GoString() string {
+	return "MirrorHeaders" + h.String()
 }
 
 // serviceConfig holds daemon configuration for the registry service.
-type serviceConfig registry.ServiceConfig
+type serviceConfig struct {
+	registry.ServiceConfig
+
+	// authEndpoints maps a registry host to the URL of its configured
+	// token auth endpoint. It is not part of the public API type.
+	authEndpoints map[string]string
+
+	// noProxyMirrors holds the hosts of mirrors that must bypass the
+	// HTTP(S) proxy environment.
+	noProxyMirrors map[string]struct{}
+
+	// mirrorWeights holds the relative weight per normalized mirror URL.
+	mirrorWeights map[string]int
+
+	// hubNondistributablePrefixes holds the repository prefixes on Docker
+	// Hub for which non-distributable artifacts are allowed via mirrors.
+	hubNondistributablePrefixes []string
+
+	// hostMirrors holds the normalized mirrors per upstream (non-Hub)
+	// registry host.
+	hostMirrors map[string][]string
+
+	// mirrorTimeouts holds the configured timeouts per normalized mirror
+	// URL.
+	mirrorTimeouts map[string]MirrorTimeout
+
+	// strictContentTypeMirrors holds the normalized URLs of mirrors whose
+	// responses must carry a registry content type.
+	strictContentTypeMirrors map[string]struct{}
+
+	// mirrorCredentials holds the resolved basic-auth credentials per
+	// normalized mirror URL. Values must never be logged.
+	mirrorCredentials map[string]MirrorAuth
+
+	// mirrorHeaders holds the extra request headers per normalized mirror
+	// URL. Header values must never be logged.
+	mirrorHeaders map[string]MirrorHeaders
+
+	// skipVerifyRegistries holds the hosts for which TLS verification is
+	// skipped without allowing a plaintext http fallback.
+	skipVerifyRegistries map[string]struct{}
+
+	// insecureRepoPrefixes holds, per registry host, the repository
+	// prefixes for which insecure endpoints are allowed even though the
+	// host is otherwise secure.
+	insecureRepoPrefixes map[string][]string
+
+	// mirrorMediaTypes holds the manifest media types served per
+	// normalized mirror URL. Absent means no restriction.
+	mirrorMediaTypes map[string][]string
+
+	// defaultRegistry, when set, replaces DefaultV2Registry as the
+	// official fallback endpoint for Docker Hub pulls.
+	defaultRegistry *url.URL
+}
 
 // TODO(thaJeztah) both the "index.docker.io" and "registry-1.docker.io" domains
 // are here for historic reasons and backward-compatibility. These domains
@@ -115,10 +321,458 @@ func newServiceConfig(options ServiceOptions) (*serviceConfig, error) {
 	if err := config.loadInsecureRegistries(options.InsecureRegistries); err != nil {
 		return nil, err
 	}
+	if err := config.loadAuthEndpoints(options.AuthEndpoints); err != nil {
+		return nil, err
+	}
+	if err := config.loadNoProxyMirrors(options.NoProxyMirrors); err != nil {
+		return nil, err
+	}
+	if err := config.loadMirrorWeights(options.MirrorWeights); err != nil {
+		return nil, err
+	}
+	if err := config.loadHubNondistributablePrefixes(options.NondistributableArtifactsHubRepositories); err != nil {
+		return nil, err
+	}
+	if err := config.loadHostMirrors(options.HostMirrors); err != nil {
+		return nil, err
+	}
+	if err := config.loadMirrorTimeouts(options.MirrorTimeouts); err != nil {
+		return nil, err
+	}
+	if err := config.loadStrictContentTypeMirrors(options.StrictContentTypeMirrors); err != nil {
+		return nil, err
+	}
+	if err := config.loadMirrorCredentials(options.MirrorCredentials); err != nil {
+		return nil, err
+	}
+	if err := config.loadMirrorHeaders(options.MirrorHeaders); err != nil {
+		return nil, err
+	}
+	if err := config.loadInsecureRepositories(options.InsecureRepositories); err != nil {
+		return nil, err
+	}
+	if err := config.loadSkipVerifyRegistries(options.SkipTLSVerifyRegistries); err != nil {
+		return nil, err
+	}
+	if err := config.loadMirrorMediaTypes(options.MirrorMediaTypes); err != nil {
+		return nil, err
+	}
+	if err := config.loadDefaultRegistry(options.DefaultRegistry); err != nil {
+		return nil, err
+	}
 
 	return config, nil
 }
 
+// loadDefaultRegistry validates and loads the override for the official
+// registry fallback endpoint.
+func (config *serviceConfig) loadDefaultRegistry(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return invalidParamWrapf(err, "invalid default registry %s", endpoint)
+	}
+	if u.Scheme != "https" {
+		return invalidParamf("invalid default registry %s: must be an https URL", endpoint)
+	}
+	if u.Host == "" {
+		return invalidParamf("invalid default registry %s: missing host", endpoint)
+	}
+	config.defaultRegistry = u
+	return nil
+}
+
+// loadSkipVerifyRegistries validates and loads the hosts for which TLS
+// verification is skipped without permitting a plaintext fallback. Unlike
+// InsecureRegistries, CIDR notation is not supported: each entry names a
+// single registry host.
+func (config *serviceConfig) loadSkipVerifyRegistries(registries []string) error {
+	if len(registries) == 0 {
+		return nil
+	}
+	out := make(map[string]struct{}, len(registries))
+	for _, r := range registries {
+		if hasScheme(r) {
+			return invalidParamf("skip-tls-verify registry %s should not contain '://'", r)
+		}
+		if err := validateHostPort(r); err != nil {
+			return invalidParamWrapf(err, "skip-tls-verify registry %s is not valid", r)
+		}
+		out[r] = struct{}{}
+	}
+	config.skipVerifyRegistries = out
+	return nil
+}
+
+// loadInsecureRepositories validates and loads the "host/repository-prefix"
+// entries for which insecure endpoints are allowed on an otherwise secure
+// host.
+func (config *serviceConfig) loadInsecureRepositories(repositories []string) error {
+	if len(repositories) == 0 {
+		return nil
+	}
+	out := make(map[string][]string, len(repositories))
+	for _, r := range repositories {
+		if hasScheme(r) {
+			return invalidParamf("insecure repository %s should not contain '://'", r)
+		}
+		host, prefix, ok := strings.Cut(r, "/")
+		if !ok || prefix == "" {
+			return invalidParamf("insecure repository %s must be in host/repository-prefix form", r)
+		}
+		if err := validateHostPort(host); err != nil {
+			return invalidParamWrapf(err, "insecure repository %s is not valid", r)
+		}
+		host = strings.ToLower(host)
+		if normalizeIndexName(host) == IndexName {
+			return invalidParamf("insecure repository overrides are not supported for Docker Hub")
+		}
+		out[host] = append(out[host], strings.Trim(prefix, "/"))
+	}
+	config.insecureRepoPrefixes = out
+	return nil
+}
+
+// isInsecureRepository reports whether the repository (the path component of
+// a reference, e.g. "internal/app") matches an insecure override configured
+// for the host. Prefixes match whole path segments.
+func (config *serviceConfig) isInsecureRepository(host, repository string) bool {
+	if repository == "" {
+		return false
+	}
+	for _, prefix := range config.insecureRepoPrefixes[strings.ToLower(host)] {
+		if repository == prefix || strings.HasPrefix(repository, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// tlsMode returns how to treat TLS for the given registry host: whether to
+// skip certificate verification, and whether a plaintext http endpoint may
+// be used as fallback. Insecure-listed hosts keep the historical combined
+// behavior (both); skip-verify-listed hosts never get the plaintext
+// fallback.
+func (config *serviceConfig) tlsMode(host string) (skipVerify, allowPlaintext bool) {
+	if !config.isSecureIndex(host) {
+		return true, true
+	}
+	if _, ok := config.skipVerifyRegistries[host]; ok {
+		return true, false
+	}
+	return false, false
+}
+
+// loadHubNondistributablePrefixes validates and loads the repository
+// prefixes on Docker Hub for which non-distributable artifacts are allowed.
+func (config *serviceConfig) loadHubNondistributablePrefixes(prefixes []string) error {
+	for _, p := range prefixes {
+		if p == "" || hasScheme(p) {
+			return invalidParamf("invalid repository prefix %q for non-distributable artifacts", p)
+		}
+	}
+	config.hubNondistributablePrefixes = append([]string(nil), prefixes...)
+	return nil
+}
+
+// loadHostMirrors validates and loads the per-host mirrors, after removing
+// duplicates. Mirrors for Docker Hub must be configured through Mirrors.
+func (config *serviceConfig) loadHostMirrors(hostMirrors map[string][]string) error {
+	if len(hostMirrors) == 0 {
+		return nil
+	}
+	out := make(map[string][]string, len(hostMirrors))
+	for host, mirrors := range hostMirrors {
+		if normalizeIndexName(host) == IndexName {
+			return invalidParamf("mirrors for %s must be configured through registry-mirrors", host)
+		}
+		if err := validateHostPort(host); err != nil {
+			return invalidParamWrapf(err, "invalid host %q in host mirrors", host)
+		}
+		mMap := map[string]struct{}{}
+		unique := make([]string, 0, len(mirrors))
+		for _, mirror := range mirrors {
+			m, err := ValidateMirror(mirror)
+			if err != nil {
+				return err
+			}
+			if _, exist := mMap[m]; !exist {
+				mMap[m] = struct{}{}
+				unique = append(unique, m)
+			}
+		}
+		out[host] = unique
+	}
+	config.hostMirrors = out
+	return nil
+}
+
+// mirrorsForHost returns the mirrors configured for the given (non-Hub)
+// registry host, or nil when the host has no mirrors.
+func (config *serviceConfig) mirrorsForHost(host string) []string {
+	return config.hostMirrors[host]
+}
+
+// loadMirrorWeights validates and loads the per-mirror weights, keyed by the
+// normalized mirror URL.
+func (config *serviceConfig) loadMirrorWeights(weights map[string]int) error {
+	if len(weights) == 0 {
+		return nil
+	}
+	mirrorWeights := make(map[string]int, len(weights))
+	for mirror, weight := range weights {
+		m, err := ValidateMirror(mirror)
+		if err != nil {
+			return err
+		}
+		if weight <= 0 {
+			return invalidParamf("invalid weight %d for mirror %s: must be positive", weight, mirror)
+		}
+		mirrorWeights[m] = weight
+	}
+	config.mirrorWeights = mirrorWeights
+	return nil
+}
+
+// orderedMirrors returns the configured mirrors in the order endpoints
+// should be built. Without configured weights this is the configuration
+// order; with weights, a weighted shuffle is applied so higher-weight
+// mirrors sort first more often.
+func (config *serviceConfig) orderedMirrors() []string {
+	if len(config.mirrorWeights) == 0 {
+		return config.Mirrors
+	}
+	remaining := append([]string(nil), config.Mirrors...)
+	out := make([]string, 0, len(remaining))
+	for len(remaining) > 0 {
+		total := 0
+		for _, m := range remaining {
+			total += config.mirrorWeight(m)
+		}
+		r := rand.Intn(total)
+		for i, m := range remaining {
+			r -= config.mirrorWeight(m)
+			if r < 0 {
+				out = append(out, m)
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// loadMirrorTimeouts validates and loads the per-mirror timeouts, keyed by
+// the normalized mirror URL.
+func (config *serviceConfig) loadMirrorTimeouts(timeouts map[string]MirrorTimeout) error {
+	if len(timeouts) == 0 {
+		return nil
+	}
+	mirrorTimeouts := make(map[string]MirrorTimeout, len(timeouts))
+	for mirror, t := range timeouts {
+		m, err := ValidateMirror(mirror)
+		if err != nil {
+			return err
+		}
+		if t.DialSeconds < 0 || t.RequestSeconds < 0 {
+			return invalidParamf("invalid timeout for mirror %s: must not be negative", mirror)
+		}
+		mirrorTimeouts[m] = t
+	}
+	config.mirrorTimeouts = mirrorTimeouts
+	return nil
+}
+
+// loadStrictContentTypeMirrors validates and loads the mirrors whose
+// responses must carry a registry content type, keyed by the normalized
+// mirror URL.
+func (config *serviceConfig) loadStrictContentTypeMirrors(mirrors []string) error {
+	if len(mirrors) == 0 {
+		return nil
+	}
+	strict := make(map[string]struct{}, len(mirrors))
+	for _, mirror := range mirrors {
+		m, err := ValidateMirror(mirror)
+		if err != nil {
+			return err
+		}
+		strict[m] = struct{}{}
+	}
+	config.strictContentTypeMirrors = strict
+	return nil
+}
+
+// loadMirrorMediaTypes validates and loads the manifest media types served
+// per mirror, keyed by the normalized mirror URL.
+func (config *serviceConfig) loadMirrorMediaTypes(mediaTypes map[string][]string) error {
+	if len(mediaTypes) == 0 {
+		return nil
+	}
+	out := make(map[string][]string, len(mediaTypes))
+	for mirror, types := range mediaTypes {
+		m, err := ValidateMirror(mirror)
+		if err != nil {
+			return err
+		}
+		if len(types) == 0 {
+			return invalidParamf("empty media type list for mirror %s: omit the mirror to allow all types", mirror)
+		}
+		for _, mt := range types {
+			if mt == "" || !strings.Contains(mt, "/") || strings.ContainsAny(mt, " \t") {
+				return invalidParamf("invalid media type %q for mirror %s", mt, mirror)
+			}
+		}
+		out[m] = types
+	}
+	config.mirrorMediaTypes = out
+	return nil
+}
+
+// loadMirrorCredentials validates and loads the per-mirror basic-auth
+// credentials, keyed by the normalized mirror URL. Passwords given as a file
+// reference are resolved here, so a bad path fails configuration loading
+// rather than the first pull. Error messages must never include the
+// password.
+func (config *serviceConfig) loadMirrorCredentials(credentials map[string]MirrorAuth) error {
+	if len(credentials) == 0 {
+		return nil
+	}
+	mirrorCredentials := make(map[string]MirrorAuth, len(credentials))
+	for mirror, auth := range credentials {
+		m, err := ValidateMirror(mirror)
+		if err != nil {
+			return err
+		}
+		if auth.Username == "" {
+			return invalidParamf("credentials for mirror %s must include a username", mirror)
+		}
+		if auth.Password != "" && auth.PasswordFile != "" {
+			return invalidParamf("credentials for mirror %s must not set both password and password-file", mirror)
+		}
+		if auth.PasswordFile != "" {
+			data, err := os.ReadFile(auth.PasswordFile)
+			if err != nil {
+				return invalidParamf("failed to read password file for mirror %s: %v", mirror, err)
+			}
+			auth.Password = strings.TrimSpace(string(data))
+			auth.PasswordFile = ""
+		}
+		if auth.Password == "" {
+			return invalidParamf("credentials for mirror %s must include a password or password-file", mirror)
+		}
+		mirrorCredentials[m] = auth
+	}
+	config.mirrorCredentials = mirrorCredentials
+	return nil
+}
+
+// loadMirrorHeaders validates and loads the extra request headers per mirror,
+// keyed by the normalized mirror URL. Error messages must never include the
+// header values, which may be secrets.
+func (config *serviceConfig) loadMirrorHeaders(headers map[string]MirrorHeaders) error {
+	if len(headers) == 0 {
+		return nil
+	}
+	out := make(map[string]MirrorHeaders, len(headers))
+	for mirror, hdrs := range headers {
+		m, err := ValidateMirror(mirror)
+		if err != nil {
+			return err
+		}
+		if len(hdrs) == 0 {
+			return invalidParamf("empty header list for mirror %s: omit the mirror instead", mirror)
+		}
+		for name, value := range hdrs {
+			if name == "" || strings.ContainsAny(name, " \t:") {
+				return invalidParamf("invalid header name %q for mirror %s", name, mirror)
+			}
+			// These are controlled by the transport; Authorization is
+			// configured through MirrorCredentials.
+			if strings.EqualFold(name, "Host") || strings.EqualFold(name, "Authorization") {
+				return invalidParamf("header %s for mirror %s cannot be overridden", name, mirror)
+			}
+			if value == "" {
+				return invalidParamf("empty value for header %s for mirror %s", name, mirror)
+			}
+		}
+		out[m] = hdrs
+	}
+	config.mirrorHeaders = out
+	return nil
+}
+
+// mirrorRequiresRegistryContentType reports whether the mirror is configured
+// for strict content-type checking.
+func (config *serviceConfig) mirrorRequiresRegistryContentType(mirror string) bool {
+	_, ok := config.strictContentTypeMirrors[mirror]
+	return ok
+}
+
+// mirrorWeight returns the configured weight for a mirror, defaulting to 1.
+func (config *serviceConfig) mirrorWeight(mirror string) int {
+	if w, ok := config.mirrorWeights[mirror]; ok {
+		return w
+	}
+	return 1
+}
+
+// loadNoProxyMirrors validates and loads the list of mirrors that must bypass
+// the proxy environment, keyed by mirror host.
+func (config *serviceConfig) loadNoProxyMirrors(mirrors []string) error {
+	if len(mirrors) == 0 {
+		return nil
+	}
+	hosts := make(map[string]struct{}, len(mirrors))
+	for _, mirror := range mirrors {
+		m, err := ValidateMirror(mirror)
+		if err != nil {
+			return err
+		}
+		u, err := url.Parse(m)
+		if err != nil {
+			return invalidParam(err)
+		}
+		// mirrorEndpoints looks hosts up in lowercase; ValidateMirror does
+		// not normalize case itself.
+		hosts[strings.ToLower(u.Host)] = struct{}{}
+	}
+	config.noProxyMirrors = hosts
+	return nil
+}
+
+// mirrorBypassesProxy reports whether the mirror at the given host is
+// configured to skip the HTTP(S) proxy environment.
+func (config *serviceConfig) mirrorBypassesProxy(host string) bool {
+	_, ok := config.noProxyMirrors[host]
+	return ok
+}
+
+// loadAuthEndpoints validates and loads the configured per-host token auth
+// endpoints to config.
+func (config *serviceConfig) loadAuthEndpoints(authEndpoints map[string]string) error {
+	if len(authEndpoints) == 0 {
+		return nil
+	}
+	endpoints := make(map[string]string, len(authEndpoints))
+	for host, endpoint := range authEndpoints {
+		if err := validateHostPort(host); err != nil {
+			return invalidParamWrapf(err, "invalid auth endpoint host %q", host)
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return invalidParamWrapf(err, "invalid auth endpoint %q for host %q", endpoint, host)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return invalidParamf("invalid auth endpoint: unsupported scheme %q in %q", u.Scheme, endpoint)
+		}
+		endpoints[host] = endpoint
+	}
+	config.authEndpoints = endpoints
+	return nil
+}
+
 // copy constructs a new ServiceConfig with a copy of the configuration in config.
 func (config *serviceConfig) copy() *registry.ServiceConfig {
 	ic := make(map[string]*registry.IndexInfo)
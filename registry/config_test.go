@@ -256,6 +256,19 @@ func TestNewServiceConfig(t *testing.T) {
 				InsecureRegistries: []string{"102.10.8.1/24"},
 			},
 		},
+		{
+			doc: "invalid auth endpoint",
+			opts: ServiceOptions{
+				AuthEndpoints: map[string]string{"example.com:5000": "ftp://auth.example.com"},
+			},
+			errStr: `invalid auth endpoint: unsupported scheme "ftp" in "ftp://auth.example.com"`,
+		},
+		{
+			doc: "valid auth endpoint",
+			opts: ServiceOptions{
+				AuthEndpoints: map[string]string{"example.com:5000": "https://auth.example.com/token"},
+			},
+		},
 	}
 
 	for _, tc := range tests {
@@ -349,17 +349,19 @@ func TestNewIndexInfo(t *testing.T) {
 	// have mirrors configured, but does have the default insecure registry
 	// CIDRs for loopback interfaces configured.
 	emptyServiceConfig := &serviceConfig{
-		IndexConfigs: map[string]*registry.IndexInfo{
-			IndexName: {
-				Name:     IndexName,
-				Mirrors:  []string{},
-				Secure:   true,
-				Official: true,
+		ServiceConfig: registry.ServiceConfig{
+			IndexConfigs: map[string]*registry.IndexInfo{
+				IndexName: {
+					Name:     IndexName,
+					Mirrors:  []string{},
+					Secure:   true,
+					Official: true,
+				},
+			},
+			InsecureRegistryCIDRs: []*registry.NetIPNet{
+				(*registry.NetIPNet)(ipv6Loopback),
+				(*registry.NetIPNet)(ipv4Loopback),
 			},
-		},
-		InsecureRegistryCIDRs: []*registry.NetIPNet{
-			(*registry.NetIPNet)(ipv6Loopback),
-			(*registry.NetIPNet)(ipv4Loopback),
 		},
 	}
 
@@ -6,6 +6,7 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/containerd/log"
 	"github.com/distribution/reference"
@@ -18,6 +19,14 @@ import (
 type Service struct {
 	config *serviceConfig
 	mu     sync.RWMutex
+
+	// insecureHook, when set, is invoked for every insecure endpoint
+	// produced by lookupV2Endpoints. See [Service.OnInsecureEndpoint].
+	insecureHook func(host, reason string)
+
+	// configSubs holds the channels of config-change subscribers. See
+	// [Service.SubscribeConfigChanges].
+	configSubs map[chan struct{}]struct{}
 }
 
 // NewService returns a new instance of [Service] ready to be installed into
@@ -49,9 +58,85 @@ func (s *Service) ReplaceConfig(options ServiceOptions) (commit func(), err erro
 		s.mu.Lock()
 		defer s.mu.Unlock()
 		s.config = config
+		s.notifyConfigChange()
 	}, nil
 }
 
+// SubscribeConfigChanges returns a channel that receives a notification each
+// time the service configuration is replaced (see [Service.ReloadConfig]),
+// so components caching endpoint decisions can invalidate them. The channel
+// has a one-element buffer and rapid successive updates coalesce: a
+// subscriber that has not consumed the previous notification gets a single
+// one covering everything since its last read, and a slow subscriber never
+// blocks a reload. The returned cancel function removes the subscription and
+// closes the channel.
+func (s *Service) SubscribeConfigChanges() (<-chan struct{}, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.configSubs == nil {
+		s.configSubs = make(map[chan struct{}]struct{})
+	}
+	ch := make(chan struct{}, 1)
+	s.configSubs[ch] = struct{}{}
+	cancel := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.configSubs[ch]; ok {
+			delete(s.configSubs, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
+
+// notifyConfigChange pings every config-change subscriber without blocking;
+// a notification already pending in a subscriber's buffer covers this change
+// too. Callers must hold s.mu.
+func (s *Service) notifyConfigChange() {
+	for ch := range s.configSubs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// ReloadConfig atomically replaces the registry service's configuration with
+// one built from the given options. It is the immediate variant of
+// [Service.ReplaceConfig], for callers that do not need to stage the change
+// as part of a larger transaction (e.g. after certs.d or the mirror list was
+// updated at runtime). TLS configuration is resolved from the active
+// configuration on every endpoint lookup, so lookups started after the
+// reload observe the new configuration while concurrent lookups see either
+// the old or the new state, never a mix.
+func (s *Service) ReloadConfig(options ServiceOptions) error {
+	commit, err := s.ReplaceConfig(options)
+	if err != nil {
+		return err
+	}
+	commit()
+	return nil
+}
+
+// OnInsecureEndpoint registers a callback that is invoked whenever endpoint
+// lookup produces an insecure endpoint; either a plain-text HTTP endpoint, or
+// an HTTPS endpoint that skips TLS verification. The callback receives the
+// host and a reason ("http" or "tls-skip-verify"), and can be used to emit an
+// audit event for insecure registry usage. It must not block, and does not
+// alter the endpoints returned by lookup.
+func (s *Service) OnInsecureEndpoint(hook func(host, reason string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.insecureHook = hook
+}
+
+// notifyInsecureEndpoint invokes the registered insecure-endpoint hook, if any.
+func (s *Service) notifyInsecureEndpoint(host, reason string) {
+	if s.insecureHook != nil {
+		s.insecureHook(host, reason)
+	}
+}
+
 // Auth contacts the public registry with the provided credentials,
 // and returns OK if authentication was successful.
 // It can be used to verify the validity of a client's credentials.
@@ -74,7 +159,7 @@ func (s *Service) Auth(ctx context.Context, authConfig *registry.AuthConfig, use
 	// Lookup endpoints for authentication but exclude mirrors to prevent
 	// sending credentials of the upstream registry to a mirror.
 	s.mu.RLock()
-	endpoints, err := s.lookupV2Endpoints(ctx, registryHostName, false)
+	endpoints, err := s.lookupV2Endpoints(ctx, registryHostName, "", false)
 	s.mu.RUnlock()
 	if err != nil {
 		if errdefs.IsContext(err) {
@@ -144,6 +229,60 @@ type APIEndpoint struct {
 	Official                       bool // Deprecated: this field was only used internally, and will be removed in the next release.
 	TrimHostname                   bool // Deprecated: hostname is now trimmed unconditionally for remote names. This field will be removed in the next release.
 	TLSConfig                      *tls.Config
+
+	// Insecure marks an endpoint for a host (or repository namespace)
+	// configured as insecure: certificate verification is disabled on the
+	// https endpoint, and the plaintext http fallback carries no TLSConfig
+	// at all. Check this field rather than TLSConfig.InsecureSkipVerify to
+	// decide whether the endpoint was supposed to be secure.
+	Insecure bool
+
+	// AuthEndpoint is the URL of the token auth endpoint configured for
+	// this host. When empty (the default), the auth endpoint is discovered
+	// through the WWW-Authenticate realm returned by the registry.
+	AuthEndpoint string
+
+	// BypassProxy indicates that this endpoint is on an internal network
+	// and must be dialed directly, ignoring the HTTP(S) proxy environment.
+	BypassProxy bool
+
+	// NondistributableArtifactsPrefixes lists the repository prefixes for
+	// which non-distributable (foreign) layers may be pulled through this
+	// endpoint. Empty means the endpoint-wide default applies.
+	NondistributableArtifactsPrefixes []string
+
+	// StrictContentType requires responses from this endpoint to carry a
+	// registry content type. The puller treats a mismatch (e.g. an HTML
+	// error page served with a 200 status by a misbehaving reverse proxy)
+	// as a failure of this endpoint and falls through to the next one.
+	StrictContentType bool
+
+	// SupportedMediaTypes, when non-empty, lists the manifest media types
+	// this mirror endpoint serves. The puller should skip the endpoint
+	// for images with other media types instead of wasting an attempt.
+	// Empty means no restriction.
+	SupportedMediaTypes []string
+
+	// MirrorAuth holds the basic-auth credentials configured for this
+	// mirror endpoint, if any. They are only valid for the mirror itself
+	// and must never be forwarded to the upstream registry or logged (the
+	// type redacts the password when formatted). Nil means no configured
+	// credentials.
+	MirrorAuth *MirrorAuth
+
+	// MirrorHeaders holds the extra request headers configured for this
+	// mirror endpoint, if any. They are attached to every request sent to
+	// the mirror itself and must never be forwarded to the upstream
+	// registry or logged (the type redacts the values when formatted).
+	// Empty means no extra headers.
+	MirrorHeaders MirrorHeaders
+
+	// DialTimeout bounds establishing a connection to this endpoint, and
+	// RequestTimeout bounds a whole request through it, so a slow endpoint
+	// fails fast and the next one is tried. Zero leaves the transport
+	// defaults in place.
+	DialTimeout    time.Duration
+	RequestTimeout time.Duration
 }
 
 // LookupPullEndpoints creates a list of v2 endpoints to try to pull from, in order of preference.
@@ -152,7 +291,19 @@ func (s *Service) LookupPullEndpoints(hostname string) (endpoints []APIEndpoint,
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	return s.lookupV2Endpoints(context.TODO(), hostname, true)
+	return s.lookupV2Endpoints(context.TODO(), hostname, "", true)
+}
+
+// LookupPullEndpointsForRepository is [Service.LookupPullEndpoints] with the
+// repository path taken into account, so per-repository insecure overrides
+// (see [ServiceOptions.InsecureRepositories]) can apply. repository is the
+// path component of the reference, e.g. "internal/app" for
+// registry.example.com/internal/app.
+func (s *Service) LookupPullEndpointsForRepository(hostname, repository string) (endpoints []APIEndpoint, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.lookupV2Endpoints(context.TODO(), hostname, repository, true)
 }
 
 // LookupPushEndpoints creates a list of v2 endpoints to try to push to, in order of preference.
@@ -161,7 +312,51 @@ func (s *Service) LookupPushEndpoints(hostname string) (endpoints []APIEndpoint,
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	return s.lookupV2Endpoints(context.TODO(), hostname, false)
+	return s.lookupV2Endpoints(context.TODO(), hostname, "", false)
+}
+
+// LookupPushEndpointsForRepository is [Service.LookupPushEndpoints] with the
+// repository path taken into account; see
+// [Service.LookupPullEndpointsForRepository].
+func (s *Service) LookupPushEndpointsForRepository(hostname, repository string) (endpoints []APIEndpoint, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.lookupV2Endpoints(context.TODO(), hostname, repository, false)
+}
+
+// LookupAllEndpoints resolves pull endpoints for every host named in the
+// active configuration: the official registry, hosts configured as insecure
+// registries, and hosts with per-host mirrors. It is intended for admin
+// introspection and does not modify any state. Hosts that fail to resolve are
+// recorded in the returned error map instead of aborting the remaining
+// lookups. Insecure registries configured as CIDR ranges name no concrete
+// host and are not included.
+func (s *Service) LookupAllEndpoints() (map[string][]APIEndpoint, map[string]error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hosts := map[string]struct{}{IndexHostname: {}}
+	for name := range s.config.IndexConfigs {
+		if name != IndexName {
+			hosts[name] = struct{}{}
+		}
+	}
+	for host := range s.config.hostMirrors {
+		hosts[host] = struct{}{}
+	}
+
+	endpoints := make(map[string][]APIEndpoint, len(hosts))
+	errs := make(map[string]error)
+	for host := range hosts {
+		eps, err := s.lookupV2Endpoints(context.TODO(), host, "", true)
+		if err != nil {
+			errs[host] = err
+			continue
+		}
+		endpoints[host] = eps
+	}
+	return endpoints, errs
 }
 
 // IsInsecureRegistry returns true if the registry at given host is configured as
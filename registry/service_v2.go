@@ -4,70 +4,154 @@ import (
 	"context"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/docker/go-connections/tlsconfig"
 )
 
-func (s *Service) lookupV2Endpoints(ctx context.Context, hostname string, includeMirrors bool) ([]APIEndpoint, error) {
+// mirrorEndpoints builds the API endpoints for the given mirror list, in
+// order. Mirror URLs are canonicalized (lowercased host, no trailing slash)
+// and deduplicated, preserving first-seen order, so the same mirror written
+// in equivalent forms does not produce duplicate endpoints for the puller to
+// waste attempts on.
+func (s *Service) mirrorEndpoints(ctx context.Context, mirrors []string) ([]APIEndpoint, error) {
 	var endpoints []APIEndpoint
+	seen := map[string]struct{}{}
+	for _, mirror := range mirrors {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !strings.HasPrefix(mirror, "http://") && !strings.HasPrefix(mirror, "https://") {
+			mirror = "https://" + mirror
+		}
+		mirrorURL, err := url.Parse(mirror)
+		if err != nil {
+			return nil, invalidParam(err)
+		}
+		mirrorURL.Host = strings.ToLower(mirrorURL.Host)
+		mirrorURL.Path = strings.TrimSuffix(mirrorURL.Path, "/")
+		if _, ok := seen[mirrorURL.String()]; ok {
+			continue
+		}
+		seen[mirrorURL.String()] = struct{}{}
+		// TODO(thaJeztah); this should all be memoized when loading the config. We're resolving mirrors and loading TLS config every time.
+		mirrorSkipVerify, _ := s.config.tlsMode(mirrorURL.Host)
+		mirrorTLSConfig, err := newTLSConfig(ctx, mirrorURL.Host, !mirrorSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		if mirrorURL.Scheme == "http" {
+			s.notifyInsecureEndpoint(mirrorURL.Host, "http")
+		} else if mirrorTLSConfig.InsecureSkipVerify {
+			s.notifyInsecureEndpoint(mirrorURL.Host, "tls-skip-verify")
+		}
+		timeout := s.config.mirrorTimeouts[mirror]
+		ep := APIEndpoint{
+			URL:                 mirrorURL,
+			Mirror:              true,
+			TLSConfig:           mirrorTLSConfig,
+			BypassProxy:         s.config.mirrorBypassesProxy(mirrorURL.Host),
+			StrictContentType:   s.config.mirrorRequiresRegistryContentType(mirror),
+			SupportedMediaTypes: s.config.mirrorMediaTypes[mirror],
+			MirrorHeaders:       s.config.mirrorHeaders[mirror],
+			DialTimeout:         time.Duration(timeout.DialSeconds) * time.Second,
+			RequestTimeout:      time.Duration(timeout.RequestSeconds) * time.Second,
+		}
+		if auth, ok := s.config.mirrorCredentials[mirror]; ok {
+			ep.MirrorAuth = &auth
+		}
+		endpoints = append(endpoints, ep)
+	}
+	return endpoints, nil
+}
+
+// lookupV2Endpoints resolves the endpoints for the given registry host.
+// repository, when non-empty, is the path component of the reference (e.g.
+// "internal/app") and allows per-repository insecure overrides to apply; an
+// empty repository evaluates host-level configuration only.
+func (s *Service) lookupV2Endpoints(ctx context.Context, hostname, repository string, includeMirrors bool) ([]APIEndpoint, error) {
+	var endpoints []APIEndpoint
+	authEndpoint := s.config.authEndpoints[hostname]
 	if hostname == DefaultNamespace || hostname == IndexHostname {
 		if includeMirrors {
-			for _, mirror := range s.config.Mirrors {
-				if ctx.Err() != nil {
-					return nil, ctx.Err()
-				}
-				if !strings.HasPrefix(mirror, "http://") && !strings.HasPrefix(mirror, "https://") {
-					mirror = "https://" + mirror
-				}
-				mirrorURL, err := url.Parse(mirror)
-				if err != nil {
-					return nil, invalidParam(err)
-				}
-				// TODO(thaJeztah); this should all be memoized when loading the config. We're resolving mirrors and loading TLS config every time.
-				mirrorTLSConfig, err := newTLSConfig(ctx, mirrorURL.Host, s.config.isSecureIndex(mirrorURL.Host))
-				if err != nil {
-					return nil, err
-				}
-				endpoints = append(endpoints, APIEndpoint{
-					URL:       mirrorURL,
-					Mirror:    true,
-					TLSConfig: mirrorTLSConfig,
-				})
+			mirrorEndpoints, err := s.mirrorEndpoints(ctx, s.config.orderedMirrors())
+			if err != nil {
+				return nil, err
+			}
+			for i := range mirrorEndpoints {
+				// Scoped opt-in for foreign layers pulled from Hub
+				// through this mirror; Hub itself remains opted out.
+				mirrorEndpoints[i].NondistributableArtifactsPrefixes = s.config.hubNondistributablePrefixes
 			}
+			endpoints = append(endpoints, mirrorEndpoints...)
+		}
+		official := DefaultV2Registry
+		if s.config.defaultRegistry != nil {
+			official = s.config.defaultRegistry
 		}
 		endpoints = append(endpoints, APIEndpoint{
-			URL:       DefaultV2Registry,
-			Official:  true,
-			TLSConfig: tlsconfig.ServerDefault(),
+			URL:          official,
+			Official:     true,
+			TLSConfig:    tlsconfig.ServerDefault(),
+			AuthEndpoint: authEndpoint,
 		})
 
 		return endpoints, nil
 	}
 
-	tlsConfig, err := newTLSConfig(ctx, hostname, s.config.isSecureIndex(hostname))
+	if includeMirrors {
+		// Pull-through caches configured for this specific (non-Hub)
+		// registry are consulted before the registry itself.
+		if mirrors := s.config.mirrorsForHost(hostname); len(mirrors) > 0 {
+			mirrorEndpoints, err := s.mirrorEndpoints(ctx, mirrors)
+			if err != nil {
+				return nil, err
+			}
+			endpoints = append(endpoints, mirrorEndpoints...)
+		}
+	}
+
+	skipVerify, allowPlaintext := s.config.tlsMode(hostname)
+	if !skipVerify && s.config.isInsecureRepository(hostname, repository) {
+		// The host is secure, but this repository lives in a namespace
+		// configured as insecure on it; this lookup (and only this one)
+		// gets the historical insecure behavior.
+		skipVerify, allowPlaintext = true, true
+	}
+	tlsConfig, err := newTLSConfig(ctx, hostname, !skipVerify)
 	if err != nil {
 		return nil, err
 	}
 
-	endpoints = []APIEndpoint{
-		{
-			URL: &url.URL{
-				Scheme: "https",
-				Host:   hostname,
-			},
-			TLSConfig: tlsConfig,
+	endpoints = append(endpoints, APIEndpoint{
+		URL: &url.URL{
+			Scheme: "https",
+			Host:   hostname,
 		},
-	}
+		TLSConfig:    tlsConfig,
+		Insecure:     tlsConfig.InsecureSkipVerify,
+		AuthEndpoint: authEndpoint,
+	})
 
 	if tlsConfig.InsecureSkipVerify {
-		endpoints = append(endpoints, APIEndpoint{
-			URL: &url.URL{
-				Scheme: "http",
-				Host:   hostname,
-			},
-			// used to check if supposed to be secure via InsecureSkipVerify
-			TLSConfig: tlsConfig,
-		})
+		s.notifyInsecureEndpoint(hostname, "tls-skip-verify")
+		// Hosts listed in SkipTLSVerifyRegistries fail closed: no
+		// plaintext http fallback is offered for them.
+		if allowPlaintext {
+			s.notifyInsecureEndpoint(hostname, "http")
+			endpoints = append(endpoints, APIEndpoint{
+				URL: &url.URL{
+					Scheme: "http",
+					Host:   hostname,
+				},
+				// No TLSConfig: this endpoint is plaintext and
+				// downstream code must not attempt TLS on it. The
+				// Insecure field records that the endpoint was never
+				// supposed to be secure.
+				Insecure:     true,
+				AuthEndpoint: authEndpoint,
+			})
+		}
 	}
 
 	return endpoints, nil
@@ -0,0 +1,479 @@
+package registry // import "github.com/docker/docker/registry"
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+)
+
+func TestInsecureEndpointHook(t *testing.T) {
+	svc, err := NewService(ServiceOptions{
+		InsecureRegistries: []string{"insecure.example.com"},
+	})
+	assert.NilError(t, err)
+
+	var events []string
+	svc.OnInsecureEndpoint(func(host, reason string) {
+		events = append(events, host+":"+reason)
+	})
+
+	endpoints, err := svc.LookupPullEndpoints("insecure.example.com")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 2))
+	assert.Check(t, is.DeepEqual(events, []string{
+		"insecure.example.com:tls-skip-verify",
+		"insecure.example.com:http",
+	}))
+
+	// A secure host must not trigger the hook.
+	events = nil
+	_, err = svc.LookupPullEndpoints("secure.example.com")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(events, 0))
+}
+
+func TestWeightedMirrorOrdering(t *testing.T) {
+	svc, err := NewService(ServiceOptions{
+		Mirrors: []string{"https://heavy.example.com", "https://light.example.com"},
+		MirrorWeights: map[string]int{
+			"https://heavy.example.com": 9,
+			"https://light.example.com": 1,
+		},
+	})
+	assert.NilError(t, err)
+
+	const iterations = 1000
+	heavyFirst := 0
+	for i := 0; i < iterations; i++ {
+		endpoints, err := svc.LookupPullEndpoints(IndexHostname)
+		assert.NilError(t, err)
+		// Mirrors precede the official endpoint.
+		assert.Check(t, is.Len(endpoints, 3))
+		if endpoints[0].URL.Host == "heavy.example.com" {
+			heavyFirst++
+		}
+	}
+	// With a 9:1 weight ratio the heavy mirror should sort first roughly
+	// 90% of the time; allow a generous margin to keep the test stable.
+	assert.Check(t, heavyFirst > iterations*7/10, "heavy mirror sorted first only %d/%d times", heavyFirst, iterations)
+}
+
+func TestHostMirrors(t *testing.T) {
+	svc, err := NewService(ServiceOptions{
+		HostMirrors: map[string][]string{
+			"registry.example.com": {"https://cache.example.com"},
+		},
+	})
+	assert.NilError(t, err)
+
+	// Pull endpoints for the mirrored host are prepended with the mirror.
+	endpoints, err := svc.LookupPullEndpoints("registry.example.com")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 2))
+	assert.Check(t, is.Equal(endpoints[0].URL.Host, "cache.example.com"))
+	assert.Check(t, endpoints[0].Mirror)
+	assert.Check(t, is.Equal(endpoints[1].URL.Host, "registry.example.com"))
+
+	// Hosts without a mapping, and push endpoints, are unaffected.
+	endpoints, err = svc.LookupPullEndpoints("other.example.com")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 1))
+	endpoints, err = svc.LookupPushEndpoints("registry.example.com")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 1))
+
+	// Hub mirrors must be configured through Mirrors.
+	_, err = NewService(ServiceOptions{
+		HostMirrors: map[string][]string{
+			"docker.io": {"https://cache.example.com"},
+		},
+	})
+	assert.Check(t, err != nil)
+}
+
+func TestMirrorTimeouts(t *testing.T) {
+	svc, err := NewService(ServiceOptions{
+		Mirrors: []string{"https://slow.example.com", "https://fast.example.com"},
+		MirrorTimeouts: map[string]MirrorTimeout{
+			"https://slow.example.com": {DialSeconds: 2, RequestSeconds: 30},
+		},
+	})
+	assert.NilError(t, err)
+
+	endpoints, err := svc.LookupPullEndpoints("docker.io")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 3))
+	byHost := map[string]APIEndpoint{}
+	for _, ep := range endpoints {
+		byHost[ep.URL.Host] = ep
+	}
+	assert.Check(t, is.Equal(byHost["slow.example.com"].DialTimeout, 2*time.Second))
+	assert.Check(t, is.Equal(byHost["slow.example.com"].RequestTimeout, 30*time.Second))
+
+	// Unconfigured endpoints keep the zero (transport default) timeouts.
+	assert.Check(t, is.Equal(byHost["fast.example.com"].DialTimeout, time.Duration(0)))
+	assert.Check(t, is.Equal(byHost[DefaultV2Registry.Host].RequestTimeout, time.Duration(0)))
+
+	// Negative timeouts are rejected.
+	_, err = NewService(ServiceOptions{
+		MirrorTimeouts: map[string]MirrorTimeout{
+			"https://slow.example.com": {DialSeconds: -1},
+		},
+	})
+	assert.Check(t, err != nil)
+}
+
+func TestStrictContentTypeMirrors(t *testing.T) {
+	svc, err := NewService(ServiceOptions{
+		Mirrors:                  []string{"https://strict.example.com", "https://lax.example.com"},
+		StrictContentTypeMirrors: []string{"https://strict.example.com"},
+	})
+	assert.NilError(t, err)
+
+	endpoints, err := svc.LookupPullEndpoints("docker.io")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 3))
+	byHost := map[string]APIEndpoint{}
+	for _, ep := range endpoints {
+		byHost[ep.URL.Host] = ep
+	}
+	assert.Check(t, byHost["strict.example.com"].StrictContentType)
+	assert.Check(t, !byHost["lax.example.com"].StrictContentType)
+	assert.Check(t, !byHost[DefaultV2Registry.Host].StrictContentType)
+}
+
+func TestSkipTLSVerifyRegistries(t *testing.T) {
+	svc, err := NewService(ServiceOptions{
+		SkipTLSVerifyRegistries: []string{"selfsigned.example.com"},
+		InsecureRegistries:      []string{"insecure.example.com"},
+	})
+	assert.NilError(t, err)
+
+	var events []string
+	svc.OnInsecureEndpoint(func(host, reason string) {
+		events = append(events, host+":"+reason)
+	})
+
+	// A skip-verify host gets a single https endpoint with verification
+	// disabled, and no plaintext fallback.
+	endpoints, err := svc.LookupPullEndpoints("selfsigned.example.com")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 1))
+	assert.Check(t, is.Equal(endpoints[0].URL.Scheme, "https"))
+	assert.Check(t, endpoints[0].TLSConfig.InsecureSkipVerify)
+	assert.Check(t, is.DeepEqual(events, []string{"selfsigned.example.com:tls-skip-verify"}))
+
+	// Insecure-listed hosts keep the combined behavior.
+	endpoints, err = svc.LookupPullEndpoints("insecure.example.com")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 2))
+
+	// Scheme or CIDR entries are rejected.
+	_, err = NewService(ServiceOptions{SkipTLSVerifyRegistries: []string{"https://selfsigned.example.com"}})
+	assert.Check(t, err != nil)
+	_, err = NewService(ServiceOptions{SkipTLSVerifyRegistries: []string{"10.0.0.0/8"}})
+	assert.Check(t, err != nil)
+}
+
+func TestInsecureEndpointShapes(t *testing.T) {
+	svc, err := NewService(ServiceOptions{
+		InsecureRegistries: []string{"insecure.example.com"},
+	})
+	assert.NilError(t, err)
+
+	// An insecure host yields a skip-verify https endpoint followed by a
+	// plaintext fallback without any TLS config; both are flagged as
+	// insecure.
+	endpoints, err := svc.LookupPullEndpoints("insecure.example.com")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 2))
+	assert.Check(t, is.Equal(endpoints[0].URL.Scheme, "https"))
+	assert.Check(t, endpoints[0].TLSConfig != nil && endpoints[0].TLSConfig.InsecureSkipVerify)
+	assert.Check(t, endpoints[0].Insecure)
+	assert.Check(t, is.Equal(endpoints[1].URL.Scheme, "http"))
+	assert.Check(t, endpoints[1].TLSConfig == nil)
+	assert.Check(t, endpoints[1].Insecure)
+
+	// A secure host gets a verifying https endpoint that is not flagged.
+	endpoints, err = svc.LookupPullEndpoints("secure.example.com")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 1))
+	assert.Check(t, endpoints[0].TLSConfig != nil && !endpoints[0].TLSConfig.InsecureSkipVerify)
+	assert.Check(t, !endpoints[0].Insecure)
+}
+
+func TestInsecureRepositories(t *testing.T) {
+	svc, err := NewService(ServiceOptions{
+		InsecureRepositories: []string{"registry.example.com/internal"},
+	})
+	assert.NilError(t, err)
+
+	// A repository under the configured prefix gets the insecure
+	// treatment: verification disabled plus a plaintext fallback.
+	endpoints, err := svc.LookupPullEndpointsForRepository("registry.example.com", "internal/app")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 2))
+	assert.Check(t, endpoints[0].TLSConfig.InsecureSkipVerify)
+	assert.Check(t, is.Equal(endpoints[1].URL.Scheme, "http"))
+
+	// Prefixes match whole path segments only.
+	endpoints, err = svc.LookupPullEndpointsForRepository("registry.example.com", "internal-tools/app")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 1))
+	assert.Check(t, !endpoints[0].TLSConfig.InsecureSkipVerify)
+
+	// Other repositories on the same host, and host-level lookups, stay
+	// secure.
+	endpoints, err = svc.LookupPullEndpointsForRepository("registry.example.com", "public/app")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 1))
+	assert.Check(t, !endpoints[0].TLSConfig.InsecureSkipVerify)
+	endpoints, err = svc.LookupPullEndpoints("registry.example.com")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 1))
+	assert.Check(t, !endpoints[0].TLSConfig.InsecureSkipVerify)
+
+	// Malformed entries and Hub overrides are rejected.
+	for _, repos := range [][]string{
+		{"registry.example.com"},
+		{"registry.example.com/"},
+		{"https://registry.example.com/internal"},
+		{"docker.io/library"},
+	} {
+		_, err = NewService(ServiceOptions{InsecureRepositories: repos})
+		assert.Check(t, err != nil, "expected %v to be rejected", repos)
+	}
+}
+
+func TestMirrorCanonicalization(t *testing.T) {
+	// The same mirror written in equivalent forms (different host casing,
+	// with and without a trailing slash) must produce a single endpoint,
+	// preserving first-seen order.
+	svc, err := NewService(ServiceOptions{
+		Mirrors: []string{
+			"https://B.example.com",
+			"https://a.example.com",
+			"https://b.example.com/",
+			"https://A.example.com/",
+		},
+	})
+	assert.NilError(t, err)
+
+	endpoints, err := svc.LookupPullEndpoints("docker.io")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 3))
+	assert.Check(t, is.Equal(endpoints[0].URL.Host, "b.example.com"))
+	assert.Check(t, is.Equal(endpoints[1].URL.Host, "a.example.com"))
+	assert.Check(t, is.Equal(endpoints[2].URL.Host, DefaultV2Registry.Host))
+
+	// http and https remain distinct endpoints.
+	svc, err = NewService(ServiceOptions{
+		Mirrors:            []string{"http://c.example.com", "https://c.example.com"},
+		InsecureRegistries: []string{"c.example.com"},
+	})
+	assert.NilError(t, err)
+	endpoints, err = svc.LookupPullEndpoints("docker.io")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 3))
+}
+
+func TestMirrorMediaTypes(t *testing.T) {
+	svc, err := NewService(ServiceOptions{
+		Mirrors: []string{"https://oci.example.com", "https://any.example.com"},
+		MirrorMediaTypes: map[string][]string{
+			"https://oci.example.com": {"application/vnd.oci.image.manifest.v1+json"},
+		},
+	})
+	assert.NilError(t, err)
+
+	endpoints, err := svc.LookupPullEndpoints("docker.io")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 3))
+	byHost := map[string]APIEndpoint{}
+	for _, ep := range endpoints {
+		byHost[ep.URL.Host] = ep
+	}
+	assert.Check(t, is.DeepEqual(byHost["oci.example.com"].SupportedMediaTypes, []string{"application/vnd.oci.image.manifest.v1+json"}))
+	assert.Check(t, is.Len(byHost["any.example.com"].SupportedMediaTypes, 0))
+	assert.Check(t, is.Len(byHost[DefaultV2Registry.Host].SupportedMediaTypes, 0))
+
+	// Empty lists and malformed media types are rejected.
+	_, err = NewService(ServiceOptions{
+		MirrorMediaTypes: map[string][]string{"https://oci.example.com": {}},
+	})
+	assert.Check(t, err != nil)
+	_, err = NewService(ServiceOptions{
+		MirrorMediaTypes: map[string][]string{"https://oci.example.com": {"not-a-media-type"}},
+	})
+	assert.Check(t, err != nil)
+}
+
+func TestDefaultRegistryOverride(t *testing.T) {
+	svc, err := NewService(ServiceOptions{DefaultRegistry: "https://hub.corp.example.com"})
+	assert.NilError(t, err)
+
+	endpoints, err := svc.LookupPullEndpoints(IndexHostname)
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 1))
+	assert.Check(t, is.Equal(endpoints[0].URL.Host, "hub.corp.example.com"))
+	assert.Check(t, endpoints[0].Official)
+
+	// Only https endpoints are accepted.
+	_, err = NewService(ServiceOptions{DefaultRegistry: "http://hub.corp.example.com"})
+	assert.Check(t, err != nil)
+	_, err = NewService(ServiceOptions{DefaultRegistry: "hub.corp.example.com"})
+	assert.Check(t, err != nil)
+}
+
+func TestMirrorHeaders(t *testing.T) {
+	svc, err := NewService(ServiceOptions{
+		Mirrors: []string{"https://cdn.example.com", "https://open.example.com"},
+		MirrorHeaders: map[string]MirrorHeaders{
+			"https://cdn.example.com": {"X-Api-Key": "secret"},
+		},
+	})
+	assert.NilError(t, err)
+
+	endpoints, err := svc.LookupPullEndpoints("docker.io")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 3))
+	byHost := map[string]APIEndpoint{}
+	for _, ep := range endpoints {
+		byHost[ep.URL.Host] = ep
+	}
+	assert.Check(t, is.Equal(byHost["cdn.example.com"].MirrorHeaders["X-Api-Key"], "secret"))
+	assert.Check(t, is.Len(byHost["open.example.com"].MirrorHeaders, 0))
+	assert.Check(t, is.Len(byHost[DefaultV2Registry.Host].MirrorHeaders, 0))
+
+	// Formatting must not leak the header value.
+	assert.Check(t, is.Equal(byHost["cdn.example.com"].MirrorHeaders.String(), "[X-Api-Key:*****]"))
+
+	// Malformed names, reserved headers and empty values are rejected.
+	for _, hdrs := range []MirrorHeaders{
+		{},
+		{"Bad Header": "v"},
+		{"Authorization": "Bearer t"},
+		{"X-Api-Key": ""},
+	} {
+		_, err = NewService(ServiceOptions{
+			MirrorHeaders: map[string]MirrorHeaders{"https://cdn.example.com": hdrs},
+		})
+		assert.Check(t, err != nil)
+	}
+}
+
+func TestMirrorCredentials(t *testing.T) {
+	svc, err := NewService(ServiceOptions{
+		Mirrors: []string{"https://auth.example.com", "https://open.example.com"},
+		MirrorCredentials: map[string]MirrorAuth{
+			"https://auth.example.com": {Username: "builder", Password: "secret"},
+		},
+	})
+	assert.NilError(t, err)
+
+	endpoints, err := svc.LookupPullEndpoints("docker.io")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(endpoints, 3))
+	byHost := map[string]APIEndpoint{}
+	for _, ep := range endpoints {
+		byHost[ep.URL.Host] = ep
+	}
+	assert.Assert(t, byHost["auth.example.com"].MirrorAuth != nil)
+	assert.Check(t, is.Equal(byHost["auth.example.com"].MirrorAuth.Username, "builder"))
+	assert.Check(t, byHost["open.example.com"].MirrorAuth == nil)
+	assert.Check(t, byHost[DefaultV2Registry.Host].MirrorAuth == nil)
+
+	// Formatting must not leak the password.
+	assert.Check(t, is.Equal(byHost["auth.example.com"].MirrorAuth.String(), "builder:*****"))
+
+	// Credentials without a username or password are rejected.
+	_, err = NewService(ServiceOptions{
+		MirrorCredentials: map[string]MirrorAuth{
+			"https://auth.example.com": {Password: "secret"},
+		},
+	})
+	assert.Check(t, err != nil)
+	_, err = NewService(ServiceOptions{
+		MirrorCredentials: map[string]MirrorAuth{
+			"https://auth.example.com": {Username: "builder"},
+		},
+	})
+	assert.Check(t, err != nil)
+}
+
+func TestLookupAllEndpoints(t *testing.T) {
+	svc, err := NewService(ServiceOptions{
+		Mirrors:            []string{"https://mirror.example.com"},
+		InsecureRegistries: []string{"insecure.example.com", "10.0.0.0/8"},
+		HostMirrors: map[string][]string{
+			"registry.example.com": {"https://cache.example.com"},
+		},
+	})
+	assert.NilError(t, err)
+
+	endpoints, errs := svc.LookupAllEndpoints()
+	assert.Check(t, is.Len(errs, 0))
+	// Hub, the insecure registry, and the mirrored host; the CIDR range
+	// names no concrete host.
+	assert.Check(t, is.Len(endpoints, 3))
+	// Hub resolves to the configured mirror plus the official endpoint.
+	assert.Check(t, is.Len(endpoints[IndexHostname], 2))
+	// The insecure host resolves to HTTPS (skip-verify) and HTTP.
+	assert.Check(t, is.Len(endpoints["insecure.example.com"], 2))
+	// The mirrored host resolves to its mirror plus itself.
+	assert.Check(t, is.Len(endpoints["registry.example.com"], 2))
+	assert.Check(t, is.Equal(endpoints["registry.example.com"][0].URL.Host, "cache.example.com"))
+}
+
+func TestSubscribeConfigChanges(t *testing.T) {
+	svc, err := NewService(ServiceOptions{})
+	assert.NilError(t, err)
+
+	ch1, cancel1 := svc.SubscribeConfigChanges()
+	ch2, cancel2 := svc.SubscribeConfigChanges()
+	defer cancel2()
+
+	// Rapid successive updates coalesce into one pending notification.
+	assert.NilError(t, svc.ReloadConfig(ServiceOptions{Mirrors: []string{"https://a.example.com"}}))
+	assert.NilError(t, svc.ReloadConfig(ServiceOptions{Mirrors: []string{"https://b.example.com"}}))
+	<-ch1
+	select {
+	case <-ch1:
+		t.Fatal("expected successive updates to coalesce")
+	default:
+	}
+	// Every subscriber is notified independently.
+	<-ch2
+
+	// A rejected configuration must not notify.
+	assert.Check(t, svc.ReloadConfig(ServiceOptions{Mirrors: []string{"example.com:5000"}}) != nil)
+	select {
+	case <-ch1:
+		t.Fatal("expected no notification for a rejected configuration")
+	default:
+	}
+
+	// Cancelling closes the channel; remaining subscribers keep working.
+	cancel1()
+	_, ok := <-ch1
+	assert.Check(t, !ok)
+	assert.NilError(t, svc.ReloadConfig(ServiceOptions{}))
+	<-ch2
+}
+
+func TestReloadConfig(t *testing.T) {
+	svc, err := NewService(ServiceOptions{})
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(svc.ServiceConfig().Mirrors, 0))
+
+	// An invalid configuration must not replace the active one.
+	err = svc.ReloadConfig(ServiceOptions{Mirrors: []string{"example.com:5000"}})
+	assert.Check(t, err != nil)
+	assert.Check(t, is.Len(svc.ServiceConfig().Mirrors, 0))
+
+	err = svc.ReloadConfig(ServiceOptions{Mirrors: []string{"https://mirror.example.com"}})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(svc.ServiceConfig().Mirrors, []string{"https://mirror.example.com/"}))
+}